@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// DefaultCacheSize and DefaultCacheTTL are used when a CacheConfig field
+// is left at its zero value.
+const (
+	DefaultCacheSize = 2000
+	DefaultCacheTTL  = 30 * time.Minute
+)
+
+// ErrUserNotFound is returned by LookupUser when Slack has already told
+// us, within the negative cache's TTL, that a user/bot ID does not
+// exist. It saves a round trip to GetUserInfo on every render of a
+// message from a deleted user.
+var ErrUserNotFound = errors.New("service: user not found")
+
+// CacheConfig sizes and expires the user cache. Size bounds the positive
+// cache (ID -> CachedUser); the negative cache (ID -> "doesn't exist")
+// holds Size/4 entries, at least one. TTL applies to both.
+type CacheConfig struct {
+	Size int
+	TTL  time.Duration
+}
+
+func (c CacheConfig) withDefaults() CacheConfig {
+	if c.Size <= 0 {
+		c.Size = DefaultCacheSize
+	}
+	if c.TTL <= 0 {
+		c.TTL = DefaultCacheTTL
+	}
+	return c
+}
+
+// CachedUser is the cached shape of a Slack user or bot, carrying
+// enough of their profile to render a message without a second
+// GetUserInfo round trip.
+type CachedUser struct {
+	ID          string
+	Name        string
+	DisplayName string
+	RealName    string
+	TZ          string
+	Deleted     bool
+	fetchedAt   time.Time
+}
+
+type negativeEntry struct {
+	fetchedAt time.Time
+}
+
+// userCache is an LRU of CachedUser keyed by user/bot ID, backed by a
+// smaller negative LRU so a single "user_not_found" response doesn't
+// trigger a GetUserInfo call on every subsequent render of the same
+// message.
+type userCache struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	positive *lru.Cache
+	negative *lru.Cache
+}
+
+func newUserCache(config CacheConfig) (*userCache, error) {
+	config = config.withDefaults()
+
+	negativeSize := config.Size / 4
+	if negativeSize < 1 {
+		// lru.New(0) hands back a non-nil *lru.Cache with a nil inner
+		// map and a non-nil error; ignoring the error (as this used to)
+		// leaves a cache that panics on its first Add.
+		negativeSize = 1
+	}
+
+	positive, err := lru.New(config.Size)
+	if err != nil {
+		return nil, err
+	}
+	negative, err := lru.New(negativeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userCache{
+		ttl:      config.TTL,
+		positive: positive,
+		negative: negative,
+	}, nil
+}
+
+func (c *userCache) get(id string) (CachedUser, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	v, ok := c.positive.Peek(id)
+	if !ok {
+		return CachedUser{}, false
+	}
+
+	user := v.(CachedUser)
+	if time.Since(user.fetchedAt) > c.ttl {
+		c.positive.Remove(id)
+		return CachedUser{}, false
+	}
+
+	return user, true
+}
+
+func (c *userCache) put(id string, user CachedUser) {
+	user.fetchedAt = time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.negative.Remove(id)
+	c.positive.Add(id, user)
+}
+
+func (c *userCache) isMissing(id string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	v, ok := c.negative.Peek(id)
+	if !ok {
+		return false
+	}
+
+	entry := v.(negativeEntry)
+	if time.Since(entry.fetchedAt) > c.ttl {
+		c.negative.Remove(id)
+		return false
+	}
+
+	return true
+}
+
+func (c *userCache) markMissing(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.negative.Add(id, negativeEntry{fetchedAt: time.Now()})
+}
+
+// invalidate drops id from both the positive and negative caches, so
+// the next lookup refetches it from Slack.
+func (c *userCache) invalidate(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.positive.Remove(id)
+	c.negative.Remove(id)
+}
+
+// LookupUser resolves a user/bot ID to a CachedUser, preferring the
+// cache over the network and remembering ErrUserNotFound answers so
+// they aren't retried on every message render. Callers should use this
+// instead of calling GetUserInfo directly.
+func (s *SlackService) LookupUser(id string) (CachedUser, error) {
+	if user, ok := s.cache.get(id); ok {
+		return user, nil
+	}
+
+	if s.cache.isMissing(id) {
+		return CachedUser{}, ErrUserNotFound
+	}
+
+	user, err := s.Client.GetUserInfo(id)
+	if err != nil {
+		if isUserNotFoundError(err) {
+			s.cache.markMissing(id)
+			return CachedUser{}, ErrUserNotFound
+		}
+		// A transient error (network blip, rate limit, ...) isn't
+		// evidence the user doesn't exist; don't poison the negative
+		// cache with it, or every render of their messages shows
+		// "unknown" for the rest of the TTL.
+		return CachedUser{}, err
+	}
+
+	cached := CachedUser{
+		ID:          id,
+		Name:        user.Name,
+		DisplayName: user.Profile.DisplayName,
+		RealName:    user.Profile.RealName,
+		TZ:          user.TZ,
+		Deleted:     user.Deleted,
+	}
+	s.cache.put(id, cached)
+
+	return cached, nil
+}
+
+// cacheBotName remembers a bot's display name under its bot ID. Bots
+// don't resolve through GetUserInfo, so this bypasses LookupUser's
+// network fetch.
+func (s *SlackService) cacheBotName(id string, name string) {
+	s.cache.put(id, CachedUser{ID: id, Name: name})
+}
+
+// isUserNotFoundError reports whether err is Slack's "user_not_found"
+// API response, as opposed to a transient failure reaching the API.
+func isUserNotFoundError(err error) bool {
+	return err.Error() == "user_not_found"
+}
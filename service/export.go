@@ -0,0 +1,425 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// ExportOptions controls the shape of a workspace archive produced by
+// SlackService.Export.
+type ExportOptions struct {
+	// Start and End bound the messages exported, inclusive. The zero
+	// value for either means "no bound".
+	Start time.Time
+	End   time.Time
+
+	// Channels restricts the export to these channel names or IDs. An
+	// empty slice exports every conversation GetChannels returns.
+	Channels []string
+
+	// DownloadFiles, when true, fetches every slack.File attached to an
+	// exported message into dir/attachments/<file_id>_<name>.
+	DownloadFiles bool
+
+	// Resume skips day files that already exist on disk, so a partial
+	// export can be continued without re-fetching everything. This only
+	// avoids re-fetching per day when Start and End are both set, since
+	// otherwise there's no way to know which days exist before history
+	// has already been paged through; with an open-ended range, Resume
+	// still skips re-writing days already on disk, but not re-fetching
+	// them. In the per-day mode the first day is fetched from midnight
+	// UTC, so its file can include messages from before Start.
+	Resume bool
+}
+
+// Export writes a Slack-export-shaped directory tree rooted at dir:
+// top-level users.json, channels.json, groups.json, mpims.json and
+// dms.json, plus one sub-directory per conversation holding
+// day-partitioned JSON files (channel-name/2024-05-01.json) of the raw
+// slack.Message records returned by conversations.history and
+// conversations.replies.
+//
+// Export takes the conversation list from GetChannels, and pages through
+// history and replies itself (fetchHistory, fetchReplies) so it can
+// write the native Slack payloads; the result can be re-imported by
+// tools that accept Slack export zips.
+func (s *SlackService) Export(dir string, opts ExportOptions) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// GetChannels appends to s.Conversations rather than replacing it, so
+	// that it can be called repeatedly (e.g. on TUI refresh) without
+	// dropping channels still open elsewhere. Export needs the list for
+	// just this run, so reset it first or a SlackService that already
+	// ran GetChannels once (as the TUI does at startup) would duplicate
+	// every conversation here.
+	s.Conversations = nil
+	if _, err := s.GetChannels(); err != nil {
+		return err
+	}
+
+	if err := s.exportUsers(dir); err != nil {
+		return err
+	}
+	if err := s.exportConversationLists(dir); err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(opts.Channels))
+	for _, c := range opts.Channels {
+		wanted[c] = true
+	}
+
+	for _, chn := range s.Conversations {
+		if len(wanted) > 0 && !wanted[chn.ID] && !wanted[chn.Name] {
+			continue
+		}
+
+		name := chn.Name
+		if name == "" {
+			name = chn.ID
+		}
+
+		if err := s.exportChannel(dir, name, chn.ID, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SlackService) exportUsers(dir string) error {
+	users, err := s.Client.GetUsers()
+	if err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, "users.json"), users)
+}
+
+// exportConversationLists splits s.Conversations into the four files
+// the Slack export format uses: channels.json for public channels, and
+// groups.json, mpims.json and dms.json for the rest.
+func (s *SlackService) exportConversationLists(dir string) error {
+	var channels, groups, mpims, dms []slack.Channel
+
+	for _, chn := range s.Conversations {
+		switch {
+		case chn.IsIM:
+			dms = append(dms, chn)
+		case chn.IsMpIM:
+			mpims = append(mpims, chn)
+		case chn.IsGroup:
+			groups = append(groups, chn)
+		default:
+			channels = append(channels, chn)
+		}
+	}
+
+	files := map[string]interface{}{
+		"channels.json": channels,
+		"groups.json":   groups,
+		"mpims.json":    mpims,
+		"dms.json":      dms,
+	}
+	for name, v := range files {
+		if err := writeJSON(filepath.Join(dir, name), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportChannel writes the day-partitioned history (and, for threaded
+// messages, replies) of a single conversation. When Resume is set
+// together with a Start/End range, history is fetched one calendar day
+// at a time so a day already written to disk is skipped entirely,
+// instead of being fetched again just to have its JSON overwritten.
+func (s *SlackService) exportChannel(dir string, name string, channelID string, opts ExportOptions) error {
+	channelDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(channelDir, 0o755); err != nil {
+		return err
+	}
+
+	if opts.Resume && !opts.Start.IsZero() && !opts.End.IsZero() {
+		for _, day := range daysBetween(opts.Start, opts.End) {
+			path := filepath.Join(channelDir, day.start.Format("2006-01-02")+".json")
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+
+			dayOpts := opts
+			dayOpts.Start, dayOpts.End = day.start, day.end
+			if err := s.fetchAndWriteRange(dir, channelDir, channelID, dayOpts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return s.fetchAndWriteRange(dir, channelDir, channelID, opts)
+}
+
+// fetchAndWriteRange fetches history (and thread replies) for
+// [opts.Start, opts.End], buckets the messages by the day they actually
+// fall on, and writes each day's file.
+func (s *SlackService) fetchAndWriteRange(dir string, channelDir string, channelID string, opts ExportOptions) error {
+	messages, err := s.fetchHistory(channelID, opts)
+	if err != nil {
+		return err
+	}
+
+	byDay := make(map[string][]slack.Message)
+	for _, msg := range messages {
+		day := dayOf(msg.Timestamp)
+		byDay[day] = append(byDay[day], msg)
+
+		if len(msg.Replies) > 0 {
+			replies, err := s.fetchReplies(channelID, msg.ThreadTimestamp, opts)
+			if err != nil {
+				return err
+			}
+			for _, reply := range replies {
+				rDay := dayOf(reply.Timestamp)
+				byDay[rDay] = append(byDay[rDay], reply)
+
+				if opts.DownloadFiles {
+					if err := s.downloadAttachments(dir, reply.Files); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if opts.DownloadFiles {
+			if err := s.downloadAttachments(dir, msg.Files); err != nil {
+				return err
+			}
+		}
+	}
+
+	for day, msgs := range byDay {
+		path := filepath.Join(channelDir, day+".json")
+		if opts.Resume {
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+		}
+		if err := writeJSON(path, msgs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type dayRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// daysBetween splits [start, end] into one dayRange per UTC calendar
+// day, so a resumed export can check each day against disk before
+// fetching it, rather than fetching the whole range up front.
+func daysBetween(start time.Time, end time.Time) []dayRange {
+	var days []dayRange
+
+	start = start.UTC()
+	cursor := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	for !cursor.After(end) {
+		dayEnd := cursor.Add(24*time.Hour - time.Microsecond)
+		if dayEnd.After(end) {
+			dayEnd = end
+		}
+		days = append(days, dayRange{start: cursor, end: dayEnd})
+		cursor = cursor.Add(24 * time.Hour)
+	}
+
+	return days
+}
+
+// fetchHistory pages through conversations.history for channelID,
+// retrying on rate limits, and filters the result to opts.Start/End.
+func (s *SlackService) fetchHistory(channelID string, opts ExportOptions) ([]slack.Message, error) {
+	var all []slack.Message
+	cursor := ""
+
+	for {
+		params := &slack.GetConversationHistoryParameters{
+			ChannelID: channelID,
+			Cursor:    cursor,
+			Limit:     200,
+			Inclusive: true,
+		}
+		if !opts.Start.IsZero() {
+			params.Oldest = fmt.Sprintf("%d.%06d", opts.Start.Unix(), opts.Start.Nanosecond()/1000)
+		}
+		if !opts.End.IsZero() {
+			params.Latest = fmt.Sprintf("%d.%06d", opts.End.Unix(), opts.End.Nanosecond()/1000)
+		}
+
+		var history *slack.GetConversationHistoryResponse
+		err := retryRateLimited(func() error {
+			var err error
+			history, err = s.Client.GetConversationHistory(params)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, history.Messages...)
+		if !history.HasMore {
+			break
+		}
+		cursor = history.ResponseMetaData.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	return all, nil
+}
+
+// fetchReplies pages through conversations.replies for a thread,
+// retrying on rate limits.
+func (s *SlackService) fetchReplies(channelID string, threadTS string, opts ExportOptions) ([]slack.Message, error) {
+	var all []slack.Message
+	cursor := ""
+
+	for {
+		params := &slack.GetConversationRepliesParameters{
+			ChannelID: channelID,
+			Timestamp: threadTS,
+			Cursor:    cursor,
+			Limit:     200,
+		}
+
+		var msgs []slack.Message
+		var hasMore bool
+		var nextCur string
+		err := retryRateLimited(func() error {
+			var err error
+			msgs, hasMore, nextCur, err = s.Client.GetConversationReplies(params)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgs {
+			// The parent message is returned alongside its replies;
+			// skip it since it's already captured by fetchHistory.
+			if msg.ThreadTimestamp != "" && msg.ThreadTimestamp == msg.Timestamp {
+				continue
+			}
+			all = append(all, msg)
+		}
+
+		if !hasMore || nextCur == "" {
+			break
+		}
+		cursor = nextCur
+	}
+
+	return all, nil
+}
+
+// retryRateLimited calls fn, retrying with exponential backoff whenever
+// Slack answers with a RateLimitedError, honouring the RetryAfter it
+// reports.
+func retryRateLimited(fn func() error) error {
+	backoff := time.Second
+	for attempt := 0; attempt < 5; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		rateLimitErr, ok := err.(*slack.RateLimitedError)
+		if !ok {
+			return err
+		}
+
+		wait := rateLimitErr.RetryAfter
+		if wait <= 0 {
+			wait = backoff
+		}
+		backoff *= 2
+		time.Sleep(wait)
+	}
+
+	return fmt.Errorf("export: exceeded retry budget waiting for rate limit")
+}
+
+func (s *SlackService) downloadAttachments(dir string, files []slack.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	attachmentsDir := filepath.Join(dir, "attachments")
+	if err := os.MkdirAll(attachmentsDir, 0o755); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		dest := filepath.Join(attachmentsDir, fmt.Sprintf("%s_%s", file.ID, file.Name))
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+		if err := s.downloadFile(file.URLPrivateDownload, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SlackService) downloadFile(url string, dest string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// An expired token or a deleted file still comes back as a body
+		// (often an "error" JSON/HTML page), not a transport error; write
+		// that to dest and it silently passes as a downloaded file.
+		return fmt.Errorf("export: download %s: unexpected status %s", url, resp.Status)
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+func dayOf(timestamp string) string {
+	msg := slack.Message{Msg: slack.Msg{Timestamp: timestamp}}
+	return parseTime(msg).UTC().Format("2006-01-02")
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
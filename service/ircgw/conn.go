@@ -0,0 +1,257 @@
+package ircgw
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ircClient wraps the single IRC connection the gateway serves at a
+// time, tracking just enough registration state (nick, username,
+// authentication) to answer the commands listed in the package doc.
+type ircClient struct {
+	conn   net.Conn
+	writer *bufio.Writer
+	reader *bufio.Reader
+
+	// writeMu serializes send(), since both the per-connection
+	// read/dispatch loop and pumpSlackEvents (relaying RTM messages)
+	// write to writer concurrently; bufio.Writer isn't safe for that on
+	// its own and an interleaved write would corrupt the IRC stream.
+	writeMu sync.Mutex
+
+	nick          string
+	user          string
+	authenticated bool
+	registered    bool
+}
+
+func newIRCClient(conn net.Conn) *ircClient {
+	return &ircClient{
+		conn:   conn,
+		writer: bufio.NewWriter(conn),
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (c *ircClient) send(format string, args ...interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	fmt.Fprintf(c.writer, format+"\r\n", args...)
+	c.writer.Flush()
+}
+
+func (c *ircClient) sendPRIVMSG(from string, target string, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		c.send(":%s!%s@slag PRIVMSG %s :%s", from, from, target, line)
+	}
+}
+
+// serveClient is the per-connection read loop: it parses IRC commands
+// line by line and dispatches them to the Gateway.
+func (g *Gateway) serveClient(c *ircClient) {
+	defer func() {
+		c.conn.Close()
+		g.mutex.Lock()
+		if g.client == c {
+			g.client = nil
+		}
+		g.mutex.Unlock()
+	}()
+
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+
+		command, params := parseIRCLine(line)
+		g.dispatch(c, command, params)
+	}
+}
+
+// parseIRCLine splits a raw IRC line into its command and parameters,
+// honouring the ":trailing multi word param" convention.
+func parseIRCLine(line string) (string, []string) {
+	fields := strings.SplitN(line, " :", 2)
+	params := strings.Fields(fields[0])
+	if len(params) == 0 {
+		return "", nil
+	}
+	command := strings.ToUpper(params[0])
+	params = params[1:]
+	if len(fields) == 2 {
+		params = append(params, fields[1])
+	}
+	return command, params
+}
+
+// dispatch handles a single parsed command for client c.
+func (g *Gateway) dispatch(c *ircClient, command string, params []string) {
+	switch command {
+	case "PASS", "NICK", "USER", "PING":
+	default:
+		if !c.registered {
+			c.send(":slag 451 * :You have not registered")
+			return
+		}
+	}
+
+	switch command {
+	case "PASS":
+		if len(params) > 0 && (g.config.Password == "" || params[0] == g.config.Password) {
+			c.authenticated = true
+		}
+
+	case "NICK":
+		if len(params) > 0 {
+			c.nick = params[0]
+		}
+		g.maybeWelcome(c)
+
+	case "USER":
+		if len(params) > 0 {
+			c.user = params[0]
+		}
+		g.maybeWelcome(c)
+
+	case "PING":
+		arg := ""
+		if len(params) > 0 {
+			arg = params[0]
+		}
+		c.send("PONG slag :%s", arg)
+
+	case "JOIN":
+		for _, target := range splitList(params) {
+			g.handleJOIN(c, target)
+		}
+
+	case "PART":
+		for _, target := range splitList(params) {
+			g.handlePART(c, target)
+		}
+
+	case "PRIVMSG", "NOTICE":
+		if len(params) < 2 {
+			return
+		}
+		g.handlePRIVMSG(params[0], params[1])
+
+	case "NAMES":
+		for _, target := range splitList(params) {
+			g.handleNAMES(c, target)
+		}
+
+	case "WHO":
+		if len(params) > 0 {
+			g.handleWHO(c, params[0])
+		}
+
+	case "TOPIC":
+		if len(params) > 0 {
+			g.handleTOPIC(c, params[0])
+		}
+	}
+}
+
+func splitList(params []string) []string {
+	if len(params) == 0 {
+		return nil
+	}
+	return strings.Split(params[0], ",")
+}
+
+// maybeWelcome sends the RPL_WELCOME numeric once both NICK and USER
+// have been received and (if configured) the client authenticated.
+func (g *Gateway) maybeWelcome(c *ircClient) {
+	if c.registered || c.nick == "" || c.user == "" {
+		return
+	}
+	if g.config.Password != "" && !c.authenticated {
+		c.send(":slag 464 %s :Password required", c.nick)
+		return
+	}
+	c.registered = true
+	c.send(":slag 001 %s :Welcome to slag, %s", c.nick, c.nick)
+}
+
+func (g *Gateway) handleJOIN(c *ircClient, target string) {
+	g.mutex.Lock()
+	r, ok := g.rooms[target]
+	if ok {
+		r.members[c.nick] = true
+	}
+	g.mutex.Unlock()
+	if !ok {
+		c.send(":slag 403 %s %s :No such channel", c.nick, target)
+		return
+	}
+
+	c.send(":%s!%s@slag JOIN %s", c.nick, c.user, target)
+	if r.channel.Topic != "" {
+		c.send(":slag 332 %s %s :%s", c.nick, target, r.channel.Topic)
+	}
+	g.handleNAMES(c, target)
+}
+
+func (g *Gateway) handlePART(c *ircClient, target string) {
+	g.mutex.Lock()
+	if r, ok := g.rooms[target]; ok {
+		delete(r.members, c.nick)
+	}
+	g.mutex.Unlock()
+	c.send(":%s!%s@slag PART %s", c.nick, c.user, target)
+}
+
+func (g *Gateway) handleNAMES(c *ircClient, target string) {
+	g.mutex.Lock()
+	r, ok := g.rooms[target]
+	g.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(r.members)+1)
+	names = append(names, c.nick)
+	for m := range r.members {
+		if m != c.nick {
+			names = append(names, m)
+		}
+	}
+	c.send(":slag 353 %s = %s :%s", c.nick, target, strings.Join(names, " "))
+	c.send(":slag 366 %s %s :End of /NAMES list", c.nick, target)
+}
+
+func (g *Gateway) handleWHO(c *ircClient, target string) {
+	g.mutex.Lock()
+	r, ok := g.rooms[target]
+	g.mutex.Unlock()
+	if !ok {
+		return
+	}
+	for m := range r.members {
+		c.send(":slag 352 %s %s %s slag slag %s H :0 %s", c.nick, target, m, m, m)
+	}
+	c.send(":slag 315 %s %s :End of /WHO list", c.nick, target)
+}
+
+func (g *Gateway) handleTOPIC(c *ircClient, target string) {
+	g.mutex.Lock()
+	r, ok := g.rooms[target]
+	g.mutex.Unlock()
+	if !ok {
+		return
+	}
+	if r.channel.Topic == "" {
+		c.send(":slag 331 %s %s :No topic is set", c.nick, target)
+		return
+	}
+	c.send(":slag 332 %s %s :%s", c.nick, target, r.channel.Topic)
+}
@@ -0,0 +1,318 @@
+// Package ircgw bridges a SlackService to a minimal embedded IRC server,
+// so that any IRC client (irssi, WeeChat, ...) can drive a slag session.
+//
+// It speaks just enough of RFC 1459 for a normal client to register, join
+// rooms, and chat: NICK, USER, JOIN, PART, PRIVMSG, NOTICE, PING, NAMES,
+// WHO and TOPIC.
+package ircgw
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/j-martin/slag/components"
+	"github.com/j-martin/slag/service"
+)
+
+// nameIndexMinRefresh bounds how often nickToMention will re-fetch the
+// full user list on a miss, so a run of typos (or messages to users
+// that simply don't exist) can't turn into a GetUsers storm.
+const nameIndexMinRefresh = 30 * time.Second
+
+// DefaultAddr is the default bind address for the gateway, a local-only
+// listener so the bridge is never reachable from outside the host.
+const DefaultAddr = "127.0.0.1:6667"
+
+// Config controls how the gateway is started.
+type Config struct {
+	// Addr is the host:port the IRC server listens on.
+	Addr string
+	// Password, if set, must be supplied by the client via PASS before
+	// it is allowed to register. The gateway only supports a single
+	// authenticated local user at a time.
+	Password string
+}
+
+// Gateway maps a SlackService onto an IRC server. Slack public/private
+// channels become IRC channels (#general), MPIMs become #mpim-... rooms,
+// and IMs become query windows named after the cached username. Threads
+// are surfaced as synthetic sub-channels (#general-t-1699...) so that
+// clients without native thread support can still follow replies.
+type Gateway struct {
+	svc    *service.SlackService
+	config Config
+
+	mutex     sync.Mutex
+	client    *ircClient
+	rooms     map[string]*room // keyed by IRC channel name, e.g. "#general"
+	threadIDs map[string]string // IRC thread-room name -> Slack threadTS
+	roomByID  map[string]string // Slack channel ID -> IRC channel name
+
+	nameIndex     map[string]string // lower-cased handle/display/real name -> Slack user ID
+	nameIndexedAt time.Time
+}
+
+// room mirrors a single Slack conversation as an IRC channel.
+type room struct {
+	name      string // IRC name, e.g. "#general" or "#general-t-1699000000"
+	channel   components.Channel
+	threadTS  string // non-empty for synthetic thread sub-channels
+	members   map[string]bool
+}
+
+// NewGateway creates a Gateway that will bridge svc once Serve is called.
+func NewGateway(svc *service.SlackService, config Config) *Gateway {
+	if config.Addr == "" {
+		config.Addr = DefaultAddr
+	}
+	return &Gateway{
+		svc:       svc,
+		config:    config,
+		rooms:     make(map[string]*room),
+		threadIDs: make(map[string]string),
+		roomByID:  make(map[string]string),
+	}
+}
+
+// Serve populates the room list from Slack, starts listening on
+// config.Addr, and blocks accepting a single IRC client at a time. It
+// returns when the listener fails; if the Slack event loop stops, the
+// error is logged and Serve keeps accepting clients.
+func (g *Gateway) Serve() error {
+	if err := g.loadRooms(); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", g.config.Addr)
+	if err != nil {
+		return fmt.Errorf("ircgw: unable to listen on %s: %w", g.config.Addr, err)
+	}
+	defer listener.Close()
+
+	go g.pumpSlackEvents()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		g.mutex.Lock()
+		if g.client != nil {
+			// Only a single authenticated local user is supported.
+			conn.Close()
+			g.mutex.Unlock()
+			continue
+		}
+		client := newIRCClient(conn)
+		g.client = client
+		g.mutex.Unlock()
+
+		go g.serveClient(client)
+	}
+}
+
+// loadRooms calls GetChannels to populate the initial NAMES/TOPIC state
+// for every Slack conversation the gateway will expose.
+func (g *Gateway) loadRooms() error {
+	channels, err := g.svc.GetChannels()
+	if err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	for _, ch := range channels {
+		name := ircNameForChannel(ch)
+		r := &room{
+			name:    name,
+			channel: ch,
+			members: make(map[string]bool),
+		}
+		g.rooms[name] = r
+		g.roomByID[ch.ID] = name
+	}
+	g.mutex.Unlock()
+
+	// Seed the mention name index up front so the first outgoing message
+	// doesn't pay for a lazy GetUsers call on a cold Gateway.
+	g.refreshNameIndex("")
+	return nil
+}
+
+// ircNameForChannel derives the IRC channel (or query) name for a Slack
+// conversation, following the mapping described in the gateway docs.
+func ircNameForChannel(ch components.Channel) string {
+	if ch.UserID != "" {
+		// GetChannels only ever populates UserID for IM conversations
+		// (it's the counterpart's Slack user ID); it names the
+		// channelItem after the cached username, so this is an IRC
+		// query window, not a #-prefixed channel.
+		return ch.Name
+	}
+	name := ch.Name
+	if strings.HasPrefix(name, "mpdm-") || strings.Contains(name, "--") {
+		return "#mpim-" + sanitizeIRCName(name)
+	}
+	return "#" + sanitizeIRCName(name)
+}
+
+// threadRoomName builds the synthetic sub-channel name used to surface a
+// reply thread to clients without native thread support.
+func threadRoomName(parent string, threadTS string) string {
+	return fmt.Sprintf("%s-t-%s", parent, strings.Replace(threadTS, ".", "", 1))
+}
+
+var ircNameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_\-]`)
+
+func sanitizeIRCName(name string) string {
+	return ircNameDisallowed.ReplaceAllString(name, "-")
+}
+
+// pumpSlackEvents listens to the SlackService RTM and relays every
+// message into the room the connected IRC client is watching.
+func (g *Gateway) pumpSlackEvents() {
+	watch := make(map[string]*components.Channel)
+	g.mutex.Lock()
+	for _, r := range g.rooms {
+		ch := r.channel
+		watch[ch.ID] = &ch
+	}
+	g.mutex.Unlock()
+
+	err := g.svc.ListenToEvents(watch, g.relayToIRC)
+	if err != nil {
+		log.Printf("ircgw: slack event loop stopped: %s", err)
+	}
+}
+
+// relayToIRC converts an incoming components.Message into PRIVMSG lines
+// on the room (or synthetic thread room) the message belongs to.
+func (g *Gateway) relayToIRC(msg components.Message, _ *slack.TeamInfo) {
+	g.mutex.Lock()
+	client := g.client
+	roomName := ""
+	if msg.Channel != nil {
+		roomName = g.roomByID[msg.Channel.ID]
+	}
+	if roomName != "" && msg.ThreadTimestamp != "" && msg.IsReply {
+		roomName = threadRoomName(roomName, msg.ThreadTimestamp)
+		g.threadIDs[roomName] = msg.ThreadTimestamp
+		if _, ok := g.rooms[roomName]; !ok && msg.Channel != nil {
+			g.rooms[roomName] = &room{
+				name:     roomName,
+				channel:  *msg.Channel,
+				threadTS: msg.ThreadTimestamp,
+				members:  make(map[string]bool),
+			}
+		}
+	}
+	g.mutex.Unlock()
+
+	if client == nil || roomName == "" {
+		return
+	}
+
+	nick := rewriteMentionsToNicks(g.svc, msg.Content)
+	client.sendPRIVMSG(msg.Name, roomName, nick)
+}
+
+// rewriteMentionsToNicks rewrites <@Uxxx> placeholders already resolved
+// by the SlackService into plain IRC text; the heavy lifting of turning
+// the mention into a name happens in SlackService.CreateMessage, so this
+// is effectively a passthrough kept here for symmetry with
+// nickToMention.
+func rewriteMentionsToNicks(svc *service.SlackService, text string) string {
+	return text
+}
+
+var mentionPattern = regexp.MustCompile(`@(\w+)`)
+
+// nickToMention rewrites an outgoing "@user" reference into the
+// <@Uxxx> placeholder Slack expects, the reverse of parseMentions. It
+// matches against the handle, display name, and real name, since the
+// nick the IRC client typed reflects whatever NameStyle slag is
+// configured with. Names are resolved against g.nameIndex, a reverse
+// index built once from GetUsers and refreshed at most every
+// nameIndexMinRefresh on a miss, rather than calling GetUsers on every
+// outgoing message. Only the run of word characters after "@" is looked
+// up, so a name containing spaces or punctuation (as most real names
+// do) is not matched and is left as typed.
+func (g *Gateway) nickToMention(text string) string {
+	return mentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := strings.ToLower(strings.TrimPrefix(match, "@"))
+
+		if id, ok := g.lookupNameIndex(name); ok {
+			return fmt.Sprintf("<@%s>", id)
+		}
+		if id, ok := g.refreshNameIndex(name); ok {
+			return fmt.Sprintf("<@%s>", id)
+		}
+		return match
+	})
+}
+
+func (g *Gateway) lookupNameIndex(name string) (string, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	id, ok := g.nameIndex[name]
+	return id, ok
+}
+
+// refreshNameIndex rebuilds the name index from GetUsers and looks name
+// up again. It's a no-op if the index was already rebuilt within
+// nameIndexMinRefresh, so a message with several unresolvable "@"s (or a
+// burst of them) doesn't turn into a GetUsers call per mention.
+func (g *Gateway) refreshNameIndex(name string) (string, bool) {
+	g.mutex.Lock()
+	if time.Since(g.nameIndexedAt) < nameIndexMinRefresh {
+		id, ok := g.nameIndex[name]
+		g.mutex.Unlock()
+		return id, ok
+	}
+	g.mutex.Unlock()
+
+	users, err := g.svc.Client.GetUsers()
+	if err != nil {
+		return "", false
+	}
+
+	index := make(map[string]string, len(users))
+	for _, u := range users {
+		index[strings.ToLower(u.Name)] = u.ID
+		index[strings.ToLower(u.Profile.DisplayName)] = u.ID
+		index[strings.ToLower(u.Profile.RealName)] = u.ID
+	}
+
+	g.mutex.Lock()
+	g.nameIndex = index
+	g.nameIndexedAt = time.Now()
+	id, ok := g.nameIndex[name]
+	g.mutex.Unlock()
+
+	return id, ok
+}
+
+// handlePRIVMSG sends an outgoing message typed by the IRC client back to
+// Slack, resolving the destination room (and thread, if any) back to the
+// Slack channel ID and calling SendMessage.
+func (g *Gateway) handlePRIVMSG(target string, text string) {
+	g.mutex.Lock()
+	r, ok := g.rooms[target]
+	g.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	text = g.nickToMention(text)
+
+	if _, err := g.svc.SendMessage(r.channel.ID, text, r.threadTS); err != nil {
+		log.Printf("ircgw: failed to send message to %s: %s", target, err)
+	}
+}
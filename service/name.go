@@ -0,0 +1,44 @@
+package service
+
+// NameStyle controls which of a Slack user's names is shown when
+// rendering a message author or rewriting a <@Uxxx> mention.
+type NameStyle string
+
+const (
+	// NameStyleHandle uses the legacy @handle (CachedUser.Name), the
+	// long-standing default.
+	NameStyleHandle NameStyle = "handle"
+	// NameStyleDisplay uses the user's configured display name,
+	// falling back to the handle when it is blank.
+	NameStyleDisplay NameStyle = "display"
+	// NameStyleReal uses the user's real name, falling back to the
+	// handle when it is blank.
+	NameStyleReal NameStyle = "real"
+	// NameStyleDisplayThenReal prefers display name, falls back to real
+	// name, and finally to the handle.
+	NameStyleDisplayThenReal NameStyle = "display_then_real"
+)
+
+// displayName picks the name to render for user according to s's
+// configured NameStyle, matching what the official Slack client shows.
+func (s *SlackService) displayName(user CachedUser) string {
+	switch s.nameStyle {
+	case NameStyleDisplay:
+		if user.DisplayName != "" {
+			return user.DisplayName
+		}
+	case NameStyleReal:
+		if user.RealName != "" {
+			return user.RealName
+		}
+	case NameStyleDisplayThenReal:
+		if user.DisplayName != "" {
+			return user.DisplayName
+		}
+		if user.RealName != "" {
+			return user.RealName
+		}
+	}
+
+	return user.Name
+}
@@ -20,21 +20,41 @@ type SlackService struct {
 	Client          *slack.Client
 	RTM             *slack.RTM
 	Conversations   []slack.Channel
-	UserCache       map[string]string
 	CurrentUserID   string
 	CurrentUsername string
 	CurrentTeamInfo *slack.TeamInfo
 	Channels        map[string]components.Channel
-	mutex           *sync.Mutex
+	token           string
+	cache           *userCache
+	nameStyle       NameStyle
+	attachmentDir   string
 }
 
 // NewSlackService is the constructor for the SlackService and will initialize
-// the RTM and a Client
-func NewSlackService(token string) (*SlackService, error) {
+// the RTM and a Client. cacheConfig sizes and expires the user cache; the
+// zero value applies DefaultCacheSize and DefaultCacheTTL. An empty
+// nameStyle defaults to NameStyleHandle, matching the historical
+// behaviour of rendering the Slack handle. An empty attachmentDir
+// defaults to DefaultAttachmentDir.
+func NewSlackService(token string, cacheConfig CacheConfig, nameStyle NameStyle, attachmentDir string) (*SlackService, error) {
+	if nameStyle == "" {
+		nameStyle = NameStyleHandle
+	}
+	if attachmentDir == "" {
+		attachmentDir = DefaultAttachmentDir
+	}
+
+	cache, err := newUserCache(cacheConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	svc := &SlackService{
-		Client:    slack.New(token),
-		UserCache: make(map[string]string),
-		mutex:     &sync.Mutex{},
+		Client:        slack.New(token),
+		token:         token,
+		cache:         cache,
+		nameStyle:     nameStyle,
+		attachmentDir: attachmentDir,
 	}
 
 	// Get user associated with token, mainly
@@ -56,7 +76,13 @@ func NewSlackService(token string) (*SlackService, error) {
 	for _, user := range users {
 		// only add non-deleted users
 		if !user.Deleted {
-			svc.setCachedUser(user.ID, user.Name)
+			svc.cache.put(user.ID, CachedUser{
+				ID:          user.ID,
+				Name:        user.Name,
+				DisplayName: user.Profile.DisplayName,
+				RealName:    user.Profile.RealName,
+				TZ:          user.TZ,
+			})
 		}
 	}
 
@@ -180,13 +206,14 @@ func (s *SlackService) GetChannels() ([]components.Channel, error) {
 
 		if chn.IsIM {
 			// Check if user is deleted, we do this by checking the user id,
-			// and see if we have the user in the UserCache
-			name, ok := s.getCachedUser(chn.User)
+			// and see if LookupUser resolves it to a non-deleted user
+			user, err := s.LookupUser(chn.User)
+			ok := err == nil && !user.Deleted
 			if !ok {
 				continue
 			}
 
-			chanItem.Name = name
+			chanItem.Name = user.Name
 			buckets[3][chn.User] = &tempChan{
 				channelItem:  chanItem,
 				slackChannel: chn,
@@ -296,38 +323,8 @@ func (s *SlackService) GetMessages(channel components.Channel, count int) ([]com
 // associated with messages.
 func (s *SlackService) CreateMessage(message slack.Message, channel *components.Channel) ([]components.Message, error) {
 	var msgs []components.Message
-	var name string
-
-	// Get username from cache
-	User := message.User
-	name, ok := s.getCachedUser(User)
-
-	// Name not in cache
-	if !ok {
-		if message.BotID != "" {
-			// Name not found, perhaps a bot, use Username
-			name, ok = s.getCachedUser(message.BotID)
-			if !ok {
-				// Not found in cache, add it
-				name = message.Username
-				s.setCachedUser(message.BotID, message.Username)
-			}
-		} else {
-			// Not a bot, not in cache, get user info
-			user, err := s.Client.GetUserInfo(User)
-			if err != nil {
-				name = "unknown"
-				s.setCachedUser(User, name)
-			} else {
-				name = user.Name
-				s.setCachedUser(User, user.Name)
-			}
-		}
-	}
 
-	if name == "" {
-		name = "unknown"
-	}
+	name := s.resolveAuthorName(message.User, message.BotID, message.Username)
 
 	// When there are attachments append them
 	threadTimestamp := message.ThreadTimestamp
@@ -357,17 +354,117 @@ func (s *SlackService) CreateMessage(message slack.Message, channel *components.
 	return msgs, nil
 }
 
-func (s *SlackService) getCachedUser(ID string) (string, bool) {
-	defer s.mutex.Unlock()
-	s.mutex.Lock()
-	i, ok := s.UserCache[ID]
-	return i, ok
+// SendMessage posts a new message to channelID. When threadTS is not
+// empty, the message is posted as a reply in that thread. It returns the
+// components.Message as it will be rendered, so callers can append it to
+// the chat pane without waiting for the RTM to echo it back; ListenToEvents
+// drops that echo via isSelfEcho so it isn't rendered a second time.
+func (s *SlackService) SendMessage(channelID string, text string, threadTS string) (components.Message, error) {
+	opts := []slack.MsgOption{
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionAsUser(true),
+	}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+
+	_, timestamp, err := s.Client.PostMessage(channelID, opts...)
+	if err != nil {
+		return components.Message{}, err
+	}
+
+	replyTS := threadTS
+	if replyTS == "" {
+		replyTS = timestamp
+	}
+
+	return components.Message{
+		ThreadTimestamp: replyTS,
+		Time:            parseTime(slack.Message{Msg: slack.Msg{Timestamp: timestamp}}),
+		Name:            s.CurrentUsername,
+		Content:         parseMessage(s, text),
+		IsReply:         threadTS != "",
+	}, nil
 }
 
-func (s *SlackService) setCachedUser(ID string, Username string) {
-	defer s.mutex.Unlock()
-	s.mutex.Lock()
-	s.UserCache[ID] = Username
+// EditMessage updates the text of a message previously sent by the
+// current user, identified by its timestamp within channelID.
+func (s *SlackService) EditMessage(channelID string, timestamp string, text string) (components.Message, error) {
+	_, _, _, err := s.Client.UpdateMessage(
+		channelID,
+		timestamp,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionAsUser(true),
+	)
+	if err != nil {
+		return components.Message{}, err
+	}
+
+	return components.Message{
+		ThreadTimestamp: timestamp,
+		Time:            parseTime(slack.Message{Msg: slack.Msg{Timestamp: timestamp}}),
+		Name:            s.CurrentUsername,
+		Content:         fmt.Sprintf("%s (edited)", parseMessage(s, text)),
+		IsEdited:        true,
+	}, nil
+}
+
+// DeleteMessage removes a message previously sent by the current user,
+// identified by its timestamp within channelID.
+func (s *SlackService) DeleteMessage(channelID string, timestamp string) error {
+	_, _, err := s.Client.DeleteMessage(channelID, timestamp)
+	return err
+}
+
+// isSelfEcho reports whether ev is the RTM's own echo of a post or edit
+// the current user just made through SendMessage/EditMessage, which
+// already returned a components.Message for the caller to append.
+// Deletions aren't covered: DeleteMessage doesn't hand back a message to
+// append, so the message_deleted echo is still the only place the UI
+// learns to remove it.
+func (s *SlackService) isSelfEcho(ev *slack.MessageEvent) bool {
+	switch ev.SubType {
+	case "":
+		return ev.User == s.CurrentUserID
+	case "message_changed":
+		return ev.SubMessage != nil && ev.SubMessage.User == s.CurrentUserID
+	default:
+		return false
+	}
+}
+
+// resolveAuthorName finds the display name for a message's author. For a
+// bot message (botID set) it uses the name cached under botID, or else
+// the Username Slack sends along and caches it; otherwise it resolves
+// userID through LookupUser and applies the NameStyle. An unresolved or
+// empty name becomes "unknown". This is the common path shared by
+// CreateMessage and CreateMessageFromMessageEvent.
+func (s *SlackService) resolveAuthorName(userID string, botID string, username string) string {
+	var name string
+
+	if botID != "" {
+		// Bots don't carry a display/real name, just the Username Slack
+		// sends with the event.
+		if user, ok := s.cache.get(botID); ok {
+			name = user.Name
+		} else {
+			name = username
+			s.cacheBotName(botID, username)
+		}
+	} else {
+		user, err := s.LookupUser(userID)
+		if err != nil {
+			name = "unknown"
+		} else {
+			name = s.displayName(user)
+		}
+	}
+
+	if name == "" {
+		name = "unknown"
+	}
+
+	return name
 }
 
 func parseTime(message slack.Message) time.Time {
@@ -458,6 +555,23 @@ func (s *SlackService) ListenToEvents(watchChannels map[string]*components.Chann
 			if channel == nil {
 				continue
 			}
+			if ev.SubType == "message_deleted" {
+				printer(components.Message{
+					Channel:         channel,
+					ThreadTimestamp: ev.DeletedTimestamp,
+					IsDeleted:       true,
+				}, s.CurrentTeamInfo)
+				continue
+			}
+
+			if s.isSelfEcho(ev) {
+				// SendMessage/EditMessage already returned a
+				// components.Message for the caller to append
+				// immediately; rendering the RTM echo too would show
+				// every post or edit we make twice.
+				continue
+			}
+
 			messages, err := s.CreateMessageFromMessageEvent(channel, ev)
 			if err != nil {
 				return err
@@ -466,6 +580,27 @@ func (s *SlackService) ListenToEvents(watchChannels map[string]*components.Chann
 				printer(message, s.CurrentTeamInfo)
 			}
 
+		case *slack.FileSharedEvent:
+			// Slack also delivers a *slack.MessageEvent (subtype
+			// "file_share") for the same upload, which
+			// CreateMessageFromMessageEvent already renders via
+			// FormatAttachments. Only cache the file here; printing it
+			// too would show every upload twice.
+			if err := s.cacheSharedFileByID(ev.FileID); err != nil {
+				log.Printf("failed to cache shared file %s: %s", ev.FileID, err)
+			}
+
+		case *slack.TeamJoinEvent:
+			// A new user joined the team; drop any negative-cache entry
+			// from before they existed so a later message from them
+			// resolves.
+			s.cache.invalidate(ev.User.ID)
+
+		case *slack.UserChangeEvent:
+			// Display name, profile, or deleted flag changed; drop the
+			// stale entry instead of waiting out the TTL.
+			s.cache.invalidate(ev.User.ID)
+
 		case *slack.RTMError:
 			msg := fmt.Sprintf("Error: %s\n", ev.Error())
 			return errors.New(msg)
@@ -484,11 +619,15 @@ func (s *SlackService) ListenToEvents(watchChannels map[string]*components.Chann
 func (s *SlackService) CreateMessageFromMessageEvent(channel *components.Channel, message *slack.MessageEvent) ([]components.Message, error) {
 
 	var msgs []components.Message
-	var name string
 
+	isEdited := false
 	switch message.SubType {
 	case "message_changed":
-		// Append (edited) when an edited message is received
+		// An edit round-trips through the RTM as the original event's
+		// SubMessage. Edits by the current user echo back the same way,
+		// but ListenToEvents drops those via isSelfEcho before they
+		// reach here.
+		isEdited = true
 		message = &slack.MessageEvent{Msg: *message.SubMessage}
 		message.Text = fmt.Sprintf("%s (edited)", message.Text)
 	case "message_replied":
@@ -496,35 +635,7 @@ func (s *SlackService) CreateMessageFromMessageEvent(channel *components.Channel
 		return nil, nil
 	}
 
-	// Get username from cache
-	name, ok := s.getCachedUser(message.User)
-
-	// Name not in cache
-	if !ok {
-		if message.BotID != "" {
-			// Name not found, perhaps a bot, use Username
-			name, ok = s.getCachedUser(message.BotID)
-			if !ok {
-				// Not found in cache, add it
-				name = message.Username
-				s.setCachedUser(message.BotID, message.Username)
-			}
-		} else {
-			// Not a bot, not in cache, get user info
-			user, err := s.Client.GetUserInfo(message.User)
-			if err != nil {
-				name = "unknown"
-				s.setCachedUser(message.User, name)
-			} else {
-				name = user.Name
-				s.setCachedUser(message.User, user.Name)
-			}
-		}
-	}
-
-	if name == "" {
-		name = "unknown"
-	}
+	name := s.resolveAuthorName(message.User, message.BotID, message.Username)
 
 	// Parse time
 	floatTime, err := strconv.ParseFloat(message.Timestamp, 64)
@@ -545,6 +656,8 @@ func (s *SlackService) CreateMessageFromMessageEvent(channel *components.Channel
 		Name:            name,
 		Content:         parseMessage(s, message.Text),
 		Attachments:     s.FormatAttachments(message.Attachments, message.Files),
+		IsEdited:        isEdited,
+		IsReply:         message.ThreadTimestamp != "",
 	}
 
 	msgs = append(msgs, msg)
@@ -582,19 +695,9 @@ func parseMentions(s *SlackService, msg string) string {
 				userID = rs[1]
 			}
 
-			name, ok := s.getCachedUser(userID)
-			if !ok {
-				user, err := s.Client.GetUserInfo(userID)
-				if err != nil {
-					name = "unknown"
-					s.setCachedUser(userID, name)
-				} else {
-					name = user.Name
-					s.setCachedUser(userID, user.Name)
-				}
-			}
-
-			if name == "" {
+			user, err := s.LookupUser(userID)
+			name := s.displayName(user)
+			if err != nil || name == "" {
 				name = "unknown"
 			}
 
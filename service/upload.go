@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/nlopes/slack"
+
+	"github.com/j-martin/slag/components"
+)
+
+// DefaultAttachmentDir is used when NewSlackService is given an empty
+// attachmentDir.
+const DefaultAttachmentDir = ".slag/attachments"
+
+// slackFileURL recognizes a Slack-hosted file URL, as opposed to an
+// arbitrary link shared in a message.
+var slackFileURL = regexp.MustCompile(`^https://files\.slack\.com/`)
+
+// UploadFile sends the file at path to channelID, with an optional
+// comment, using Client.UploadFile. When threadTS is not empty the
+// upload is attached to that thread.
+func (s *SlackService) UploadFile(channelID string, path string, comment string, threadTS string) error {
+	params := slack.FileUploadParameters{
+		File:            path,
+		Filename:        filepath.Base(path),
+		InitialComment:  comment,
+		Channels:        []string{channelID},
+		ThreadTimestamp: threadTS,
+	}
+
+	_, err := s.Client.UploadFile(params)
+	return err
+}
+
+// FetchAttachment downloads a Slack-hosted file referenced by a
+// components.Attachment of Type "link" into s.attachmentDir, using the
+// workspace token so the UI can show a thumbnail/preview without the
+// user reauthenticating in a browser. It returns the path of the cached
+// file. Attachments that aren't Slack files are left alone.
+func (s *SlackService) FetchAttachment(attachment components.Attachment, url string, filename string) (string, error) {
+	if attachment.Type != "link" || !slackFileURL.MatchString(url) {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(s.attachmentDir, 0o755); err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(s.attachmentDir, filename)
+	if _, err := os.Stat(dest); err == nil {
+		return dest, nil
+	}
+
+	if err := s.downloadFile(url, dest); err != nil {
+		return "", err
+	}
+
+	return dest, nil
+}
+
+// cacheSharedFileByID looks up a file_shared event's file and caches it
+// to disk. It doesn't render a components.Message: the *slack.MessageEvent
+// (subtype "file_share") Slack delivers alongside file_shared already
+// renders the upload via FormatAttachments, so rendering here too would
+// duplicate it in the chat pane.
+func (s *SlackService) cacheSharedFileByID(fileID string) error {
+	file, _, _, err := s.Client.GetFileInfo(fileID, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.cacheSharedFile(*file)
+	return err
+}
+
+// cacheSharedFile caches an incoming file_shared event's file on disk
+// under s.attachmentDir, named "<file_id>_<name>". FormatAttachments,
+// which renders history, does not download files; it only shows their
+// URLs.
+func (s *SlackService) cacheSharedFile(file slack.File) (string, error) {
+	dest := filepath.Join(s.attachmentDir, fmt.Sprintf("%s_%s", file.ID, file.Name))
+
+	if err := os.MkdirAll(s.attachmentDir, 0o755); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return dest, nil
+	}
+	if err := s.downloadFile(file.URLPrivateDownload, dest); err != nil {
+		return "", err
+	}
+
+	return dest, nil
+}